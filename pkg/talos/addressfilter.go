@@ -0,0 +1,176 @@
+package talos
+
+import (
+	"net/netip"
+
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// addressScope is a coarse address-scope selector usable in an
+// AddressFilter.
+type addressScope string
+
+const (
+	// addressScopeGlobal matches routable, non-private addresses.
+	addressScopeGlobal addressScope = "global"
+
+	// addressScopeLinkLocal matches link-local unicast addresses
+	// (169.254.0.0/16, fe80::/10). Multicast addresses, link-local or
+	// not, match no scope.
+	addressScopeLinkLocal addressScope = "link-local"
+
+	// addressScopeULA matches RFC1918 and IPv6 ULA (fc00::/7) addresses.
+	addressScopeULA addressScope = "ula"
+)
+
+// AddressFilter declaratively assigns a v1.NodeAddressType to interface
+// addresses matching all of its non-empty selectors. A cloudConfig's
+// AddressFilters are evaluated top-to-bottom per address; the first
+// filter that matches wins, and an address matched by no filter is not
+// reported as a Node address at all.
+type AddressFilter struct {
+	// Platform restricts this filter to a single Talos platform, e.g.
+	// "metal". Empty matches every platform.
+	Platform string `yaml:"platform,omitempty"`
+
+	// LinkNames are glob patterns (see path.Match) matched against the
+	// interface link name. Empty matches every link.
+	LinkNames []string `yaml:"linkNames,omitempty"`
+
+	// IncludeCIDRs, if set, requires the address to fall in at least one
+	// of these prefixes.
+	IncludeCIDRs []string `yaml:"includeCIDRs,omitempty"`
+
+	// ExcludeCIDRs excludes any address falling in one of these
+	// prefixes, even if it also matches IncludeCIDRs.
+	ExcludeCIDRs []string `yaml:"excludeCIDRs,omitempty"`
+
+	// Scopes, if set, restricts matches to addresses of these scopes.
+	Scopes []addressScope `yaml:"scopes,omitempty"`
+
+	// Type is the v1.NodeAddressType assigned to a matching address. An
+	// empty Type matches but assigns no address type, i.e. a "deny" rule
+	// that drops the address without falling through to later filters.
+	Type v1.NodeAddressType `yaml:"type"`
+}
+
+// kubespanSkipFilter drops KubeSpan's virtual interface addresses before
+// any later filter gets a chance to classify them: an AddressFilter with
+// no Type matches but assigns the zero v1.NodeAddressType, which
+// matchAddressFilters' caller treats as "don't report this address".
+var kubespanSkipFilter = AddressFilter{LinkNames: []string{kubespanLinkName}}
+
+// defaultAddressFilters returns the built-in AddressFilter profile for a
+// Talos platform, reproducing the CCM's historical per-platform address
+// selection. It is used whenever cloudConfigGlobal.AddressFilters is
+// empty.
+func defaultAddressFilters(platform string) []AddressFilter {
+	if platform == "gcp" {
+		return []AddressFilter{
+			kubespanSkipFilter,
+			{LinkNames: []string{externalLinkName}, Type: v1.NodeExternalIP},
+		}
+	}
+
+	// nocloud, metal, and any other platform: every global-scope address
+	// is classified as a NodeExternalIP; getNodeAddresses then keeps the
+	// first IPv4 and the last IPv6 of them.
+	return []AddressFilter{
+		kubespanSkipFilter,
+		{Scopes: []addressScope{addressScopeGlobal}, Type: v1.NodeExternalIP},
+	}
+}
+
+// matchAddressFilters evaluates filters top-to-bottom against iface and
+// returns the v1.NodeAddressType of the first one that matches.
+func matchAddressFilters(filters []AddressFilter, platform string, iface network.AddressStatusSpec) (v1.NodeAddressType, bool) {
+	for _, filter := range filters {
+		if filter.matches(platform, iface) {
+			return filter.Type, true
+		}
+	}
+
+	return "", false
+}
+
+// matches reports whether f applies to iface on the given platform.
+func (f AddressFilter) matches(platform string, iface network.AddressStatusSpec) bool {
+	if f.Platform != "" && f.Platform != platform {
+		return false
+	}
+
+	if len(f.LinkNames) > 0 && !matchesAnyGlob(f.LinkNames, iface.LinkName) {
+		return false
+	}
+
+	addr := iface.Address.Addr()
+
+	for _, cidr := range f.ExcludeCIDRs {
+		if prefixContains(cidr, addr) {
+			return false
+		}
+	}
+
+	if len(f.IncludeCIDRs) > 0 && !matchesAnyCIDR(f.IncludeCIDRs, addr) {
+		return false
+	}
+
+	if len(f.Scopes) > 0 && !matchesAnyScope(f.Scopes, addr) {
+		return false
+	}
+
+	return true
+}
+
+// prefixContains reports whether addr falls within cidr. An unparsable
+// cidr never matches.
+func prefixContains(cidr string, addr netip.Addr) bool {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return false
+	}
+
+	return prefix.Contains(addr)
+}
+
+// matchesAnyCIDR reports whether addr falls within at least one of cidrs.
+func matchesAnyCIDR(cidrs []string, addr netip.Addr) bool {
+	for _, cidr := range cidrs {
+		if prefixContains(cidr, addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addrScope classifies addr into an addressScope. It returns the empty
+// scope for addresses that should never be reported as a Node address
+// (unspecified, loopback, multicast), so they match no Scopes selector.
+func addrScope(addr netip.Addr) addressScope {
+	switch {
+	case !addr.IsValid(), addr.IsUnspecified(), addr.IsLoopback(), addr.IsMulticast():
+		return ""
+	case addr.IsLinkLocalUnicast(), addr.IsLinkLocalMulticast():
+		return addressScopeLinkLocal
+	case addr.IsPrivate():
+		return addressScopeULA
+	default:
+		return addressScopeGlobal
+	}
+}
+
+// matchesAnyScope reports whether addr belongs to one of scopes.
+func matchesAnyScope(scopes []addressScope, addr netip.Addr) bool {
+	scope := addrScope(addr)
+
+	for _, candidate := range scopes {
+		if candidate == scope {
+			return true
+		}
+	}
+
+	return false
+}
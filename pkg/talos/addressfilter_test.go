@@ -0,0 +1,95 @@
+package talos
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAddressFilterMatches(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		filter   AddressFilter
+		platform string
+		iface    network.AddressStatusSpec
+		expected bool
+	}{
+		{
+			name:     "platform mismatch",
+			filter:   AddressFilter{Platform: "gcp"},
+			platform: "metal",
+			iface:    network.AddressStatusSpec{Address: netip.MustParsePrefix("1.2.3.4/24")},
+			expected: false,
+		},
+		{
+			name:     "link name glob matches",
+			filter:   AddressFilter{LinkNames: []string{"eth*"}},
+			platform: "metal",
+			iface:    network.AddressStatusSpec{Address: netip.MustParsePrefix("1.2.3.4/24"), LinkName: "eth0"},
+			expected: true,
+		},
+		{
+			name:     "link name glob mismatches",
+			filter:   AddressFilter{LinkNames: []string{"eth*"}},
+			platform: "metal",
+			iface:    network.AddressStatusSpec{Address: netip.MustParsePrefix("1.2.3.4/24"), LinkName: "tailscale0"},
+			expected: false,
+		},
+		{
+			name:     "exclude CIDR wins over include CIDR",
+			filter:   AddressFilter{IncludeCIDRs: []string{"1.2.0.0/16"}, ExcludeCIDRs: []string{"1.2.3.0/24"}},
+			platform: "metal",
+			iface:    network.AddressStatusSpec{Address: netip.MustParsePrefix("1.2.3.4/24")},
+			expected: false,
+		},
+		{
+			name:     "scope selector matches",
+			filter:   AddressFilter{Scopes: []addressScope{addressScopeULA}},
+			platform: "metal",
+			iface:    network.AddressStatusSpec{Address: netip.MustParsePrefix("192.168.0.1/24")},
+			expected: true,
+		},
+		{
+			name:     "scope selector mismatches",
+			filter:   AddressFilter{Scopes: []addressScope{addressScopeGlobal}},
+			platform: "metal",
+			iface:    network.AddressStatusSpec{Address: netip.MustParsePrefix("192.168.0.1/24")},
+			expected: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.filter.matches(tt.platform, tt.iface))
+		})
+	}
+}
+
+func TestDefaultAddressFiltersGCPOnlyUsesExternalLink(t *testing.T) {
+	filters := defaultAddressFilters("gcp")
+
+	addressType, ok := matchAddressFilters(filters, "gcp", network.AddressStatusSpec{
+		Address: netip.MustParsePrefix("1.2.3.4/24"), LinkName: "eth0",
+	})
+	assert.False(t, ok)
+	assert.Empty(t, addressType)
+
+	addressType, ok = matchAddressFilters(filters, "gcp", network.AddressStatusSpec{
+		Address: netip.MustParsePrefix("1.2.3.4/24"), LinkName: "external",
+	})
+	assert.True(t, ok)
+	assert.Equal(t, v1.NodeExternalIP, addressType)
+}
+
+func TestDefaultAddressFiltersDropsKubespan(t *testing.T) {
+	for _, platform := range []string{"gcp", "nocloud", "metal"} {
+		addressType, ok := matchAddressFilters(defaultAddressFilters(platform), platform, network.AddressStatusSpec{
+			Address: netip.MustParsePrefix("1.2.3.4/24"), LinkName: "kubespan",
+		})
+		assert.True(t, ok)
+		assert.Empty(t, addressType)
+	}
+}
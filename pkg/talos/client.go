@@ -0,0 +1,55 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+
+	talosclient "github.com/siderolabs/talos/pkg/machinery/client"
+	talosclientconfig "github.com/siderolabs/talos/pkg/machinery/client/config"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// client wraps the Talos API client and the Kubernetes client used by the
+// cloud provider. The Kubernetes client is populated later, via
+// Initialize, once the cloud-provider framework hands us a ClientBuilder.
+type client struct {
+	cfg *cloudConfig
+
+	talos   *talosclient.Client
+	kclient kubernetes.Interface
+
+	// csrPolicy is cfg.Global.CSRApprovalPolicy, parsed and validated once
+	// at startup by newClient, so csrNodeChecks never has to re-parse it
+	// (or silently fall back) at CSR time.
+	csrPolicy *csrPolicy
+}
+
+// newClient builds a Talos API client from the given cloudConfig. The
+// talosconfig itself is read from the TALOSCONFIG environment variable (or
+// the default location) following the standard Talos client conventions.
+func newClient(ctx context.Context, cfg *cloudConfig) (*client, error) {
+	talosconfig, err := talosclientconfig.Open("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open talosconfig: %w", err)
+	}
+
+	talos, err := talosclient.New(ctx,
+		talosclient.WithConfig(talosconfig),
+		talosclient.WithEndpoints(cfg.Global.Endpoints...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create talos client: %w", err)
+	}
+
+	policy, err := cfg.csrPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve CSR approval policy: %w", err)
+	}
+
+	return &client{
+		cfg:       cfg,
+		talos:     talos,
+		csrPolicy: policy,
+	}, nil
+}
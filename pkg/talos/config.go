@@ -0,0 +1,41 @@
+package talos
+
+// cloudConfig is the configuration for the Talos cloud provider, usually
+// loaded from the --cloud-config flag.
+type cloudConfig struct {
+	Global cloudConfigGlobal `yaml:"global"`
+}
+
+// cloudConfigGlobal holds the settings that apply to the whole cluster,
+// as opposed to a single node or platform.
+type cloudConfigGlobal struct {
+	// ClusterName is recorded on every Node as the ClusterNameNodeLabel.
+	ClusterName string `yaml:"clusterName"`
+
+	// Endpoints is the list of Talos API endpoints the controller dials.
+	Endpoints []string `yaml:"endpoints"`
+
+	// PreferIPv6 reorders a node's addresses so that the IPv6 entries are
+	// reported before the IPv4 ones.
+	PreferIPv6 bool `yaml:"preferIPv6"`
+
+	// CSRApprovalPolicy is a HuJSON-encoded csrPolicy controlling which
+	// kubelet-serving CSRs csrNodeChecks approves. When empty,
+	// defaultCSRPolicy is used.
+	CSRApprovalPolicy string `yaml:"csrApprovalPolicy"`
+
+	// RouteGraceWindow is how long a previously advertised ExternalIP
+	// keeps being reported after Talos stops reporting the interface it
+	// was discovered on, e.g. "5m". Defaults to defaultRouteGraceWindow.
+	RouteGraceWindow string `yaml:"routeGraceWindow"`
+
+	// ExternalLinkNames, when non-empty, restricts ExternalIP discovery
+	// to addresses seen on one of these link names. An empty list defers
+	// to the per-platform heuristics in getNodeAddresses.
+	ExternalLinkNames []string `yaml:"externalLinkNames"`
+
+	// AddressFilters declaratively assigns a Node address type to
+	// interface addresses; see AddressFilter. When empty,
+	// defaultAddressFilters(platform) is used instead.
+	AddressFilters []AddressFilter `yaml:"addressFilters"`
+}
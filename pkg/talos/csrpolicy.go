@@ -0,0 +1,205 @@
+package talos
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+
+	"github.com/tailscale/hujson"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// csrRuleAction is the outcome applied when a csrRule matches a CSR.
+type csrRuleAction string
+
+const (
+	// csrActionApprove approves the CSR unconditionally.
+	csrActionApprove csrRuleAction = "approve"
+
+	// csrActionDeny denies the CSR unconditionally.
+	csrActionDeny csrRuleAction = "deny"
+
+	// csrActionRequireTalosVerification approves the CSR only if every
+	// requested IP address SAN is already known to belong to the node, per
+	// verifyCSRAgainstNode. DNS name SANs are not checked by this action.
+	csrActionRequireTalosVerification csrRuleAction = "require-talos-verification"
+)
+
+// csrMatch describes the conditions a CSR and its target node must meet
+// for a csrRule to apply. Every non-empty field must match; an empty
+// csrMatch matches anything.
+type csrMatch struct {
+	// NodeNames are glob patterns (see path.Match) matched against the
+	// node name.
+	NodeNames []string `json:"nodeNames,omitempty"`
+
+	// NodeLabels must all be present on the node with the given values.
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+
+	// Platform matches the node's ClusterNodePlatformLabel.
+	Platform string `json:"platform,omitempty"`
+
+	// DNSNames are glob patterns that every SAN DNS name in the CSR must
+	// match at least one of.
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// IPFamilies restricts which address families ("ipv4", "ipv6") are
+	// allowed to appear in the CSR's IPAddresses SANs.
+	IPFamilies []string `json:"ipFamilies,omitempty"`
+}
+
+// csrRule is a single entry of a csrPolicy: when Match applies to a CSR,
+// Action is taken and evaluation of the remaining rules is skipped.
+type csrRule struct {
+	Name   string        `json:"name,omitempty"`
+	Match  csrMatch      `json:"match"`
+	Action csrRuleAction `json:"action"`
+}
+
+// csrPolicy is an ordered, HuJSON-configured ACL-style list of csrRule,
+// evaluated top-to-bottom. The first rule whose Match applies decides the
+// outcome; a CSR matched by no rule is denied.
+type csrPolicy struct {
+	Rules []csrRule `json:"rules"`
+}
+
+// defaultCSRPolicy is used whenever cloudConfigGlobal.CSRApprovalPolicy is
+// empty. It reproduces the CCM's original behavior: every CSR is subject
+// to verifyCSRAgainstNode's check of its IP address SANs.
+func defaultCSRPolicy() *csrPolicy {
+	return &csrPolicy{
+		Rules: []csrRule{
+			{
+				Name:   "default-talos-verification",
+				Action: csrActionRequireTalosVerification,
+			},
+		},
+	}
+}
+
+// parseCSRPolicy decodes a HuJSON-encoded csrPolicy, tolerating the
+// comments and trailing commas HuJSON allows over plain JSON.
+func parseCSRPolicy(raw string) (*csrPolicy, error) {
+	standardized, err := hujson.Standardize([]byte(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR approval policy: %w", err)
+	}
+
+	var policy csrPolicy
+	if err := json.Unmarshal(standardized, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse CSR approval policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// csrPolicy resolves cfg.Global.CSRApprovalPolicy into a validated
+// *csrPolicy, falling back to defaultCSRPolicy when it's empty. It is
+// meant to be called once, at CCM startup, so that a malformed policy
+// fails newClient instead of every CSR being silently denied at runtime.
+func (cfg *cloudConfig) csrPolicy() (*csrPolicy, error) {
+	if cfg.Global.CSRApprovalPolicy == "" {
+		return defaultCSRPolicy(), nil
+	}
+
+	policy, err := parseCSRPolicy(cfg.Global.CSRApprovalPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCSRPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// validateCSRPolicy checks that a csrPolicy is well-formed: every rule has
+// a known action and every glob pattern compiles. It is meant to be run
+// once at CCM startup so a bad policy fails fast instead of at CSR time.
+func validateCSRPolicy(policy *csrPolicy) error {
+	for i, rule := range policy.Rules {
+		switch rule.Action {
+		case csrActionApprove, csrActionDeny, csrActionRequireTalosVerification:
+		default:
+			return fmt.Errorf("CSR approval policy rule %d (%q): unknown action %q", i, rule.Name, rule.Action)
+		}
+
+		for _, pattern := range append(append([]string{}, rule.Match.NodeNames...), rule.Match.DNSNames...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("CSR approval policy rule %d (%q): invalid glob %q: %w", i, rule.Name, pattern, err)
+			}
+		}
+
+		for _, family := range rule.Match.IPFamilies {
+			if family != "ipv4" && family != "ipv6" {
+				return fmt.Errorf("CSR approval policy rule %d (%q): unknown IP family %q", i, rule.Name, family)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether m applies to a CSR for the given node.
+func (m csrMatch) matches(node *v1.Node, cert *x509.CertificateRequest) bool {
+	if len(m.NodeNames) > 0 && !matchesAnyGlob(m.NodeNames, node.Name) {
+		return false
+	}
+
+	for key, value := range m.NodeLabels {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+
+	if m.Platform != "" && node.Labels[ClusterNodePlatformLabel] != m.Platform {
+		return false
+	}
+
+	if len(m.DNSNames) > 0 {
+		for _, dnsName := range cert.DNSNames {
+			if !matchesAnyGlob(m.DNSNames, dnsName) {
+				return false
+			}
+		}
+	}
+
+	if len(m.IPFamilies) > 0 {
+		for _, ip := range cert.IPAddresses {
+			if !matchesAnyIPFamily(m.IPFamilies, ip) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// matchesAnyGlob reports whether value matches at least one of patterns.
+func matchesAnyGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, value); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesAnyIPFamily reports whether ip belongs to one of families
+// ("ipv4", "ipv6").
+func matchesAnyIPFamily(families []string, ip net.IP) bool {
+	isIPv4 := ip.To4() != nil
+
+	for _, family := range families {
+		if (family == "ipv4" && isIPv4) || (family == "ipv6" && !isIPv4) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,190 @@
+package talos
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseCSRPolicy(t *testing.T) {
+	raw := `{
+		// deny anything from the staging label first
+		"rules": [
+			{"name": "deny-staging", "match": {"nodeLabels": {"env": "staging"}}, "action": "deny"},
+			{"name": "approve-metal", "match": {"platform": "metal"}, "action": "approve"},
+		],
+	}`
+
+	policy, err := parseCSRPolicy(raw)
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 2)
+	assert.Equal(t, csrActionDeny, policy.Rules[0].Action)
+	assert.Equal(t, csrActionApprove, policy.Rules[1].Action)
+}
+
+func TestValidateCSRPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		policy    *csrPolicy
+		expectErr bool
+	}{
+		{
+			name:   "empty policy is valid",
+			policy: &csrPolicy{},
+		},
+		{
+			name: "known action is valid",
+			policy: &csrPolicy{Rules: []csrRule{
+				{Name: "r1", Action: csrActionApprove},
+			}},
+		},
+		{
+			name: "unknown action is invalid",
+			policy: &csrPolicy{Rules: []csrRule{
+				{Name: "r1", Action: "reboot"},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "unknown IP family is invalid",
+			policy: &csrPolicy{Rules: []csrRule{
+				{Name: "r1", Action: csrActionApprove, Match: csrMatch{IPFamilies: []string{"ipv9"}}},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "invalid glob is invalid",
+			policy: &csrPolicy{Rules: []csrRule{
+				{Name: "r1", Action: csrActionApprove, Match: csrMatch{NodeNames: []string{"["}}},
+			}},
+			expectErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCSRPolicy(tt.policy)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCsrNodeChecksPolicyPrecedence(t *testing.T) {
+	ctx := context.Background()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node1",
+			Labels: map[string]string{
+				ClusterNodePlatformLabel: "metal",
+			},
+		},
+	}
+
+	kclient := fake.NewSimpleClientset(node)
+	cert := &x509.CertificateRequest{DNSNames: []string{"node1"}}
+
+	for _, tt := range []struct {
+		name     string
+		policy   *csrPolicy
+		expected bool
+	}{
+		{
+			name: "first matching rule wins: approve before deny",
+			policy: &csrPolicy{Rules: []csrRule{
+				{Name: "approve-metal", Match: csrMatch{Platform: "metal"}, Action: csrActionApprove},
+				{Name: "deny-all", Action: csrActionDeny},
+			}},
+			expected: true,
+		},
+		{
+			name: "first matching rule wins: deny before approve",
+			policy: &csrPolicy{Rules: []csrRule{
+				{Name: "deny-all", Action: csrActionDeny},
+				{Name: "approve-metal", Match: csrMatch{Platform: "metal"}, Action: csrActionApprove},
+			}},
+			expected: false,
+		},
+		{
+			name: "no matching rule denies by default",
+			policy: &csrPolicy{Rules: []csrRule{
+				{Name: "approve-gcp", Match: csrMatch{Platform: "gcp"}, Action: csrActionApprove},
+			}},
+			expected: false,
+		},
+		{
+			name: "node name glob matches",
+			policy: &csrPolicy{Rules: []csrRule{
+				{Name: "approve-node-glob", Match: csrMatch{NodeNames: []string{"node*"}}, Action: csrActionApprove},
+			}},
+			expected: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			approve, err := csrNodeChecks(ctx, kclient, cert, tt.policy)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, approve)
+		})
+	}
+}
+
+func TestCsrMatchIPFamilies(t *testing.T) {
+	cert := &x509.CertificateRequest{
+		DNSNames: []string{"node1"},
+		IPAddresses: []net.IP{
+			net.ParseIP("1.2.3.4"),
+			net.ParseIP("2000::1"),
+		},
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+
+	assert.True(t, (csrMatch{IPFamilies: []string{"ipv4", "ipv6"}}).matches(node, cert))
+	assert.False(t, (csrMatch{IPFamilies: []string{"ipv4"}}).matches(node, cert))
+}
+
+func TestCloudConfigCSRPolicy(t *testing.T) {
+	t.Run("empty config falls back to defaultCSRPolicy", func(t *testing.T) {
+		cfg := cloudConfig{}
+
+		policy, err := cfg.csrPolicy()
+		require.NoError(t, err)
+		assert.Equal(t, defaultCSRPolicy(), policy)
+	})
+
+	t.Run("valid policy is parsed", func(t *testing.T) {
+		cfg := cloudConfig{Global: cloudConfigGlobal{
+			CSRApprovalPolicy: `{"rules": [{"name": "approve-metal", "match": {"platform": "metal"}, "action": "approve"}]}`,
+		}}
+
+		policy, err := cfg.csrPolicy()
+		require.NoError(t, err)
+		require.Len(t, policy.Rules, 1)
+		assert.Equal(t, csrActionApprove, policy.Rules[0].Action)
+	})
+
+	t.Run("malformed HuJSON is an error", func(t *testing.T) {
+		cfg := cloudConfig{Global: cloudConfigGlobal{CSRApprovalPolicy: `{rules: [`}}
+
+		_, err := cfg.csrPolicy()
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid policy fails validation", func(t *testing.T) {
+		cfg := cloudConfig{Global: cloudConfigGlobal{
+			CSRApprovalPolicy: `{"rules": [{"name": "r1", "action": "reboot"}]}`,
+		}}
+
+		_, err := cfg.csrPolicy()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,331 @@
+package talos
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+	"github.com/siderolabs/talos/pkg/machinery/resources/runtime"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+)
+
+const (
+	// externalLinkName is the Talos link name GCP instances publish their
+	// external (NAT) address on.
+	externalLinkName = "external"
+
+	// kubespanLinkName is the virtual KubeSpan interface; its addresses
+	// are never node addresses.
+	kubespanLinkName = "kubespan"
+)
+
+// getNodeAddresses builds the list of v1.NodeAddress for a node, given the
+// Talos platform it runs on, the provided Node IP (the
+// node.alpha.kubernetes.io/provided-node-ip annotation, usually populated
+// from --node-ip) and the interface addresses Talos reports for it.
+//
+// providedIP may be a single address or, per KEP-3705, a comma-separated
+// "IPv4,IPv6" dual-stack pair; each address becomes its own NodeInternalIP
+// entry, in the order given. Every address in providedIP must be reported
+// by Talos for nodeName, or getNodeAddresses returns an error instead of
+// silently trusting a stale or misconfigured --node-ip.
+//
+// Every interface address is classified by cfg.Global.AddressFilters
+// (or, if empty, defaultAddressFilters(platform)): the first filter that
+// matches an address assigns it a v1.NodeAddressType, and an address
+// matched by no filter is dropped. A provided IP classified as a
+// NodeInternalIP is not reported a second time.
+//
+// routes is the node's discoveredRouteStore as of the previous poll (the
+// zero value is fine for a node seen for the first time); getNodeAddresses
+// returns the updated store, which the caller is responsible for
+// persisting (see saveDiscoveredRoutes). Folding this poll's candidates
+// through the store lets a previously advertised ExternalIP keep being
+// reported for cfg's grace window after Talos briefly stops reporting the
+// link it came from, e.g. across a DHCP renewal or a link flap.
+func getNodeAddresses(cfg *cloudConfig, nodeName, platform, providedIP string, ifaces []network.AddressStatusSpec, routes discoveredRouteStore, now time.Time) ([]v1.NodeAddress, discoveredRouteStore, error) {
+	providedAddrs, err := parseProvidedIPs(providedIP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ensureNodeProvidedIPsExists(nodeName, providedAddrs, ifaces); err != nil {
+		return nil, nil, err
+	}
+
+	addresses := make([]v1.NodeAddress, 0, len(providedAddrs)+2)
+	providedSet := make(map[string]struct{}, len(providedAddrs))
+	for _, addr := range providedAddrs {
+		addresses = append(addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: addr.String()})
+		providedSet[addr.String()] = struct{}{}
+	}
+
+	filters := cfg.Global.AddressFilters
+	if len(filters) == 0 {
+		filters = defaultAddressFilters(platform)
+	}
+
+	candidates := map[string]discoveredRoute{}
+	internal := make([]v1.NodeAddress, 0)
+
+	for _, iface := range ifaces {
+		addressType, ok := matchAddressFilters(filters, platform, iface)
+		if !ok {
+			continue
+		}
+
+		addr := iface.Address.Addr()
+
+		switch addressType {
+		case v1.NodeInternalIP:
+			if _, ok := providedSet[addr.String()]; ok {
+				continue
+			}
+
+			internal = append(internal, v1.NodeAddress{Type: v1.NodeInternalIP, Address: addr.String()})
+		case v1.NodeExternalIP:
+			if !cfg.externalLinkAllowed(iface.LinkName) {
+				continue
+			}
+
+			family := "ipv6"
+			if addr.Is4() {
+				family = "ipv4"
+
+				// First matching IPv4 wins.
+				if _, ok := candidates[family]; ok {
+					continue
+				}
+			}
+
+			// Last matching IPv6 on an allowed link wins.
+			candidates[family] = discoveredRoute{LinkName: iface.LinkName, Address: addr.String(), LastSeen: now}
+		}
+	}
+
+	routes = mergeDiscoveredRoutes(cfg, platform, filters, routes, candidates, now)
+
+	external := make([]v1.NodeAddress, 0, 2)
+	if route, ok := routes["ipv4"]; ok {
+		external = append(external, v1.NodeAddress{Type: v1.NodeExternalIP, Address: route.Address})
+	}
+	if route, ok := routes["ipv6"]; ok {
+		external = append(external, v1.NodeAddress{Type: v1.NodeExternalIP, Address: route.Address})
+	}
+
+	if cfg.Global.PreferIPv6 && len(external) == 2 {
+		external[0], external[1] = external[1], external[0]
+	}
+
+	addresses = append(addresses, internal...)
+
+	return append(addresses, external...), routes, nil
+}
+
+// parseProvidedIPs parses the node.alpha.kubernetes.io/provided-node-ip
+// annotation value into one or, for dual-stack nodes, two addresses of
+// opposite families. It rejects anything that isn't a valid single address
+// or IPv4,IPv6 pair.
+func parseProvidedIPs(providedIP string) ([]netip.Addr, error) {
+	parts := strings.Split(providedIP, ",")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("invalid node IP %q: at most two comma-separated addresses are supported", providedIP)
+	}
+
+	addrs := make([]netip.Addr, 0, len(parts))
+
+	for _, part := range parts {
+		addr, err := netip.ParseAddr(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid node IP %q: %w", providedIP, err)
+		}
+
+		if addr.IsUnspecified() {
+			return nil, fmt.Errorf("invalid node IP %q: address %s is unspecified", providedIP, addr)
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	if len(addrs) == 2 && addrs[0].Is4() == addrs[1].Is4() {
+		return nil, fmt.Errorf("invalid node IP %q: dual-stack addresses must be of different families", providedIP)
+	}
+
+	return addrs, nil
+}
+
+// nodeIPsNotFoundError reports that one or more of a node's provided IPs
+// were not found among the addresses Talos reports for it.
+type nodeIPsNotFoundError struct {
+	nodeName  string
+	requested []netip.Addr
+	existing  []netip.Addr
+}
+
+func (e *nodeIPsNotFoundError) Error() string {
+	return fmt.Sprintf("not all specified Node IPs %v found in cloudprovider for node '%s', existing Node IPs are %v",
+		e.requested, e.nodeName, e.existing)
+}
+
+// ensureNodeProvidedIPsExists cross-checks every provided Node IP against
+// the addresses Talos actually reports for the node, mirroring
+// cloud-provider-azure's nodemanager.ensureNodeProvidedIPsExists. It
+// returns a *nodeIPsNotFoundError if any provided IP isn't backed by a
+// Talos interface address, so the CCM refuses to initialize a node with a
+// bogus --node-ip rather than silently mis-labelling it.
+func ensureNodeProvidedIPsExists(nodeName string, providedAddrs []netip.Addr, ifaces []network.AddressStatusSpec) error {
+	existingSet := make(map[netip.Addr]struct{}, len(ifaces))
+	existing := make([]netip.Addr, 0, len(ifaces))
+
+	for _, iface := range ifaces {
+		addr := iface.Address.Addr()
+		if _, ok := existingSet[addr]; ok {
+			continue
+		}
+
+		existingSet[addr] = struct{}{}
+		existing = append(existing, addr)
+	}
+
+	for _, addr := range providedAddrs {
+		if _, ok := existingSet[addr]; !ok {
+			return &nodeIPsNotFoundError{nodeName: nodeName, requested: providedAddrs, existing: existing}
+		}
+	}
+
+	return nil
+}
+
+// syncNodeLabels applies the cluster name, platform and lifecycle labels
+// derived from the Talos platform metadata onto the given node.
+func syncNodeLabels(c *client, node *v1.Node, meta *runtime.PlatformMetadataSpec) error {
+	ctx := context.Background()
+
+	current, err := c.kclient.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get node %s: %w", node.Name, err)
+	}
+
+	labels := current.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	labels[ClusterNameNodeLabel] = c.cfg.Global.ClusterName
+
+	if meta.Platform != "" {
+		labels[ClusterNodePlatformLabel] = meta.Platform
+	}
+
+	if meta.Spot {
+		labels[ClusterNodeLifeCycleLabel] = "spot"
+	}
+
+	current.Labels = labels
+
+	if _, err := c.kclient.CoreV1().Nodes().Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update node %s: %w", node.Name, err)
+	}
+
+	return nil
+}
+
+// csrNodeChecks decides whether a kubelet-serving CSR should be approved,
+// by evaluating policy top-to-bottom and applying the first matching
+// rule's action. A nil policy falls back to defaultCSRPolicy. A CSR
+// matched by no rule is denied.
+func csrNodeChecks(ctx context.Context, kclient kubernetes.Interface, cert *x509.CertificateRequest, policy *csrPolicy) (bool, error) {
+	if len(cert.DNSNames) == 0 {
+		csrApprovalOutcomesTotal.WithLabelValues("", "error").Inc()
+
+		return false, fmt.Errorf("no DNS names in CSR")
+	}
+
+	if policy == nil {
+		policy = defaultCSRPolicy()
+	}
+
+	nodeName := cert.DNSNames[0]
+
+	node, err := kclient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		csrApprovalOutcomesTotal.WithLabelValues("", "error").Inc()
+
+		return false, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+
+	for _, rule := range policy.Rules {
+		if !rule.Match.matches(node, cert) {
+			continue
+		}
+
+		switch rule.Action {
+		case csrActionApprove:
+			csrApprovalOutcomesTotal.WithLabelValues(rule.Name, "approve").Inc()
+
+			return true, nil
+		case csrActionDeny:
+			csrApprovalOutcomesTotal.WithLabelValues(rule.Name, "deny").Inc()
+
+			return false, nil
+		case csrActionRequireTalosVerification:
+			approved := verifyCSRAgainstNode(node, cert)
+			outcome := "deny"
+
+			if approved {
+				outcome = "approve"
+			}
+
+			csrApprovalOutcomesTotal.WithLabelValues(rule.Name, outcome).Inc()
+
+			return approved, nil
+		}
+	}
+
+	csrApprovalOutcomesTotal.WithLabelValues("", "deny").Inc()
+
+	return false, nil
+}
+
+// verifyCSRAgainstNode approves a kubelet-serving CSR only if every IP
+// address it requests is already known to belong to the node: either the
+// node's provided Node IP annotation, or one of its existing
+// Status.Addresses. For a dual-stack node this naturally covers both its
+// IPv4 and IPv6 InternalIP, since both are present in Status.Addresses.
+func verifyCSRAgainstNode(node *v1.Node, cert *x509.CertificateRequest) bool {
+	allowedIPs := map[string]struct{}{}
+
+	if providedIP, ok := node.Annotations[cloudproviderapi.AnnotationAlphaProvidedIPAddr]; ok {
+		// providedIP may be a comma-separated "IPv4,IPv6" dual-stack pair
+		// (see parseProvidedIPs); an invalid value is simply not trusted,
+		// same as a missing annotation.
+		if addrs, err := parseProvidedIPs(providedIP); err == nil {
+			for _, addr := range addrs {
+				allowedIPs[addr.String()] = struct{}{}
+			}
+		}
+	}
+
+	for _, address := range node.Status.Addresses {
+		switch address.Type {
+		case v1.NodeInternalIP, v1.NodeExternalIP:
+			allowedIPs[address.Address] = struct{}{}
+		}
+	}
+
+	for _, ip := range cert.IPAddresses {
+		if _, ok := allowedIPs[ip.String()]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
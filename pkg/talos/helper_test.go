@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -23,12 +24,13 @@ func TestGetNodeAddresses(t *testing.T) {
 	cfg := cloudConfig{}
 
 	for _, tt := range []struct {
-		name       string
-		cfg        cloudConfig
-		platform   string
-		providedIP string
-		ifaces     []network.AddressStatusSpec
-		expected   []v1.NodeAddress
+		name        string
+		cfg         cloudConfig
+		platform    string
+		providedIP  string
+		ifaces      []network.AddressStatusSpec
+		expected    []v1.NodeAddress
+		expectedErr string
 	}{
 		{
 			name:       "nocloud has no PublicIPs",
@@ -122,15 +124,242 @@ func TestGetNodeAddresses(t *testing.T) {
 				{Type: v1.NodeExternalIP, Address: "2001:1234::1"},
 			},
 		},
+		{
+			name:       "dual-stack provided node IP",
+			cfg:        cfg,
+			platform:   "metal",
+			providedIP: "192.168.0.1,fd15:1:2::192:168:0:1",
+			ifaces: []network.AddressStatusSpec{
+				{Address: netip.MustParsePrefix("192.168.0.1/24")},
+				{Address: netip.MustParsePrefix("fd15:1:2::192:168:0:1/64")},
+				{Address: netip.MustParsePrefix("1.2.3.4/24")},
+			},
+			expected: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+				{Type: v1.NodeInternalIP, Address: "fd15:1:2::192:168:0:1"},
+				{Type: v1.NodeExternalIP, Address: "1.2.3.4"},
+			},
+		},
+		{
+			name:        "dual-stack provided node IP rejects same family",
+			cfg:         cfg,
+			platform:    "metal",
+			providedIP:  "192.168.0.1,192.168.0.2",
+			expectedErr: `invalid node IP "192.168.0.1,192.168.0.2": dual-stack addresses must be of different families`,
+		},
+		{
+			name:        "dual-stack provided node IP rejects a third address",
+			cfg:         cfg,
+			platform:    "metal",
+			providedIP:  "192.168.0.1,fd15:1:2::192:168:0:1,1.2.3.4",
+			expectedErr: `invalid node IP "192.168.0.1,fd15:1:2::192:168:0:1,1.2.3.4": at most two comma-separated addresses are supported`,
+		},
+		{
+			name:        "dual-stack provided node IP rejects an unspecified address",
+			cfg:         cfg,
+			platform:    "metal",
+			providedIP:  "192.168.0.1,::",
+			expectedErr: `invalid node IP "192.168.0.1,::": address :: is unspecified`,
+		},
+		{
+			name:       "provided node IP not found on any interface",
+			cfg:        cfg,
+			platform:   "metal",
+			providedIP: "192.168.0.1",
+			ifaces: []network.AddressStatusSpec{
+				{Address: netip.MustParsePrefix("10.0.0.5/24")},
+			},
+			expectedErr: "not all specified Node IPs [192.168.0.1] found in cloudprovider for node 'node1', existing Node IPs are [10.0.0.5]",
+		},
+		{
+			name:       "dual-stack provided node IP partially not found",
+			cfg:        cfg,
+			platform:   "metal",
+			providedIP: "192.168.0.1,2001::1",
+			ifaces: []network.AddressStatusSpec{
+				{Address: netip.MustParsePrefix("192.168.0.1/24")},
+			},
+			expectedErr: "not all specified Node IPs [192.168.0.1 2001::1] found in cloudprovider for node 'node1', existing Node IPs are [192.168.0.1]",
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			addresses := getNodeAddresses(&tt.cfg, tt.platform, tt.providedIP, tt.ifaces)
+			addresses, _, err := getNodeAddresses(&tt.cfg, "node1", tt.platform, tt.providedIP, tt.ifaces, nil, time.Now())
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+
+				return
+			}
 
+			assert.NoError(t, err)
 			assert.Equal(t, tt.expected, addresses)
 		})
 	}
 }
 
+func TestGetNodeAddressesRouteGraceWindow(t *testing.T) {
+	cfg := cloudConfig{Global: cloudConfigGlobal{RouteGraceWindow: "1m"}}
+
+	withExternal := []network.AddressStatusSpec{
+		{Address: netip.MustParsePrefix("192.168.0.1/24")},
+		{Address: netip.MustParsePrefix("1.2.3.4/24"), LinkName: "eth0"},
+	}
+	withoutExternal := []network.AddressStatusSpec{
+		{Address: netip.MustParsePrefix("192.168.0.1/24")},
+	}
+
+	t0 := time.Now()
+
+	addresses, routes, err := getNodeAddresses(&cfg, "node1", "metal", "192.168.0.1", withExternal, nil, t0)
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+		{Type: v1.NodeExternalIP, Address: "1.2.3.4"},
+	}, addresses)
+
+	// The interface carrying the ExternalIP flaps away, but we're still
+	// inside the grace window: the last-known ExternalIP keeps being
+	// reported instead of being dropped from Node.Status.Addresses.
+	addresses, routes, err = getNodeAddresses(&cfg, "node1", "metal", "192.168.0.1", withoutExternal, routes, t0.Add(30*time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+		{Type: v1.NodeExternalIP, Address: "1.2.3.4"},
+	}, addresses)
+
+	// Past the grace window, the stale route is finally forgotten.
+	addresses, _, err = getNodeAddresses(&cfg, "node1", "metal", "192.168.0.1", withoutExternal, routes, t0.Add(2*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+	}, addresses)
+}
+
+func TestGetNodeAddressesRouteReconfig(t *testing.T) {
+	ifaces := []network.AddressStatusSpec{
+		{Address: netip.MustParsePrefix("192.168.0.1/24")},
+		{Address: netip.MustParsePrefix("1.2.3.4/24"), LinkName: "eth0"},
+	}
+
+	now := time.Now()
+
+	cfg := cloudConfig{}
+
+	_, routes, err := getNodeAddresses(&cfg, "node1", "metal", "192.168.0.1", ifaces, nil, now)
+	assert.NoError(t, err)
+	assert.Contains(t, routes, "ipv4")
+
+	// The operator narrows the allow-list to a different link: even
+	// though we're still well inside the grace window, the route
+	// discovered on the now-disallowed "eth0" link is garbage collected
+	// immediately rather than kept around until it expires.
+	cfg.Global.ExternalLinkNames = []string{"tailscale0"}
+
+	addresses, routes, err := getNodeAddresses(&cfg, "node1", "metal", "192.168.0.1", []network.AddressStatusSpec{
+		{Address: netip.MustParsePrefix("192.168.0.1/24")},
+	}, routes, now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+	}, addresses)
+	assert.NotContains(t, routes, "ipv4")
+}
+
+func TestGetNodeAddressesRouteReconfigFilters(t *testing.T) {
+	ifaces := []network.AddressStatusSpec{
+		{Address: netip.MustParsePrefix("192.168.0.1/24")},
+		{Address: netip.MustParsePrefix("1.2.3.4/24"), LinkName: "eth0"},
+	}
+
+	now := time.Now()
+
+	cfg := cloudConfig{Global: cloudConfigGlobal{
+		AddressFilters: []AddressFilter{
+			{LinkNames: []string{"eth0"}, Type: v1.NodeExternalIP},
+		},
+	}}
+
+	_, routes, err := getNodeAddresses(&cfg, "node1", "metal", "192.168.0.1", ifaces, nil, now)
+	assert.NoError(t, err)
+	assert.Contains(t, routes, "ipv4")
+
+	// The operator narrows AddressFilters - not the legacy
+	// ExternalLinkNames - to stop matching eth0: even though we're still
+	// well inside the grace window, the stale route discovered there is
+	// garbage collected immediately rather than kept around until it
+	// expires.
+	cfg.Global.AddressFilters = []AddressFilter{
+		{LinkNames: []string{"tailscale0"}, Type: v1.NodeExternalIP},
+	}
+
+	addresses, routes, err := getNodeAddresses(&cfg, "node1", "metal", "192.168.0.1", []network.AddressStatusSpec{
+		{Address: netip.MustParsePrefix("192.168.0.1/24")},
+	}, routes, now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+	}, addresses)
+	assert.NotContains(t, routes, "ipv4")
+}
+
+func TestGetNodeAddressesCustomAddressFilters(t *testing.T) {
+	ifaces := []network.AddressStatusSpec{
+		{Address: netip.MustParsePrefix("192.168.0.1/24")},
+		{Address: netip.MustParsePrefix("100.64.0.1/10"), LinkName: "tailscale0"},
+		{Address: netip.MustParsePrefix("2001:1234::1/64"), LinkName: "eth0"},
+	}
+
+	// The built-in metal profile promotes every global-scope address to
+	// an ExternalIP, regardless of link - including the CGNAT address on
+	// tailscale0, since 100.64.0.0/10 isn't RFC1918/ULA.
+	builtin, _, err := getNodeAddresses(&cloudConfig{}, "node1", "metal", "192.168.0.1", ifaces, nil, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+		{Type: v1.NodeExternalIP, Address: "100.64.0.1"},
+		{Type: v1.NodeExternalIP, Address: "2001:1234::1"},
+	}, builtin)
+
+	// A custom profile promotes the CGNAT range on tailscale0 to an
+	// InternalIP instead, and only treats eth0 as the ExternalIP source -
+	// a different address selection and ordering than the built-in metal
+	// profile produces for the same interfaces.
+	custom := cloudConfig{Global: cloudConfigGlobal{
+		AddressFilters: []AddressFilter{
+			{LinkNames: []string{"tailscale0"}, IncludeCIDRs: []string{"100.64.0.0/10"}, Type: v1.NodeInternalIP},
+			{LinkNames: []string{"eth0"}, Type: v1.NodeExternalIP},
+		},
+	}}
+
+	withCustomFilters, _, err := getNodeAddresses(&custom, "node1", "metal", "192.168.0.1", ifaces, nil, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+		{Type: v1.NodeInternalIP, Address: "100.64.0.1"},
+		{Type: v1.NodeExternalIP, Address: "2001:1234::1"},
+	}, withCustomFilters)
+}
+
+func TestGetNodeAddressesCustomFilterDoesNotDuplicateProvidedIP(t *testing.T) {
+	ifaces := []network.AddressStatusSpec{
+		{Address: netip.MustParsePrefix("192.168.0.1/24"), LinkName: "eth0"},
+	}
+
+	// A misconfigured custom filter re-classifies the node's own --node-ip
+	// as an InternalIP too: it must not be reported twice.
+	cfg := cloudConfig{Global: cloudConfigGlobal{
+		AddressFilters: []AddressFilter{
+			{LinkNames: []string{"eth0"}, Type: v1.NodeInternalIP},
+		},
+	}}
+
+	addresses, _, err := getNodeAddresses(&cfg, "node1", "metal", "192.168.0.1", ifaces, nil, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "192.168.0.1"},
+	}, addresses)
+}
+
 func TestSyncNodeLabels(t *testing.T) {
 	t.Setenv("TALOSCONFIG", "../../hack/talosconfig")
 
@@ -299,6 +528,18 @@ func TestCsrNodeChecks(t *testing.T) {
 					},
 				},
 			},
+			{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Node",
+					APIVersion: "v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node-dualstack",
+					Annotations: map[string]string{
+						cloudproviderapi.AnnotationAlphaProvidedIPAddr: "1.2.3.4,2000::1",
+					},
+				},
+			},
 			{
 				TypeMeta: metav1.TypeMeta{
 					Kind:       "Node",
@@ -390,6 +631,18 @@ func TestCsrNodeChecks(t *testing.T) {
 			expectedError: nil,
 			expected:      true,
 		},
+		{
+			name: "dual-stack node with only the provided-IP annotation set, no Status.Addresses yet",
+			cert: &x509.CertificateRequest{
+				DNSNames: []string{"node-dualstack"},
+				IPAddresses: []net.IP{
+					net.ParseIP("1.2.3.4"),
+					net.ParseIP("2000::1"),
+				},
+			},
+			expectedError: nil,
+			expected:      true,
+		},
 		{
 			name: "node with node-IPs",
 			cert: &x509.CertificateRequest{
@@ -405,7 +658,7 @@ func TestCsrNodeChecks(t *testing.T) {
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			kclient := fake.NewSimpleClientset(nodes)
-			approve, err := csrNodeChecks(ctx, kclient, tt.cert)
+			approve, err := csrNodeChecks(ctx, kclient, tt.cert, nil)
 
 			if tt.expectedError != nil {
 				assert.Equal(t, tt.expectedError.Error(), err.Error())
@@ -0,0 +1,19 @@
+package talos
+
+const (
+	// ClusterNameNodeLabel records the cluster name on every Node managed
+	// by this cloud provider.
+	ClusterNameNodeLabel = "cluster.talos.dev/cluster-name"
+
+	// ClusterNodePlatformLabel records the Talos platform the node was
+	// booted on, e.g. "metal" or "nocloud".
+	ClusterNodePlatformLabel = "cluster.talos.dev/platform"
+
+	// ClusterNodeLifeCycleLabel records the node lifecycle, e.g. "spot"
+	// for preemptible instances.
+	ClusterNodeLifeCycleLabel = "cluster.talos.dev/lifecycle"
+
+	// DiscoveredRoutesNodeAnnotation persists a node's discoveredRouteStore
+	// as JSON, so previously advertised ExternalIPs survive a CCM restart.
+	DiscoveredRoutesNodeAnnotation = "cluster.talos.dev/discovered-routes"
+)
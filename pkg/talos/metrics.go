@@ -0,0 +1,13 @@
+package talos
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// csrApprovalOutcomesTotal counts CSR approval decisions per matching rule
+// and outcome ("approve", "deny" or "error").
+var csrApprovalOutcomesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "talos_ccm_csr_approval_outcomes_total",
+	Help: "Number of CSR approval decisions made by the CSR approval policy, by rule name and outcome.",
+}, []string{"rule", "outcome"})
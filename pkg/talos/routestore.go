@@ -0,0 +1,160 @@
+package talos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// defaultRouteGraceWindow is used when cloudConfigGlobal.RouteGraceWindow
+// is unset or invalid.
+const defaultRouteGraceWindow = 5 * time.Minute
+
+// discoveredRoute is a single ExternalIP the CCM has advertised for a
+// node, and the link name and time it was last actually observed on.
+type discoveredRoute struct {
+	LinkName string    `json:"linkName"`
+	Address  string    `json:"address"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// discoveredRouteStore is the persisted set of discoveredRoute for a node,
+// keyed by address family ("ipv4" or "ipv6"). It is serialized as JSON
+// into DiscoveredRoutesNodeAnnotation so it survives CCM restarts.
+type discoveredRouteStore map[string]discoveredRoute
+
+// loadDiscoveredRoutes reads a node's discoveredRouteStore from its
+// DiscoveredRoutesNodeAnnotation. A missing annotation is not an error: it
+// simply means nothing has been discovered for the node yet.
+func loadDiscoveredRoutes(node *v1.Node) (discoveredRouteStore, error) {
+	raw, ok := node.Annotations[DiscoveredRoutesNodeAnnotation]
+	if !ok || raw == "" {
+		return discoveredRouteStore{}, nil
+	}
+
+	var store discoveredRouteStore
+	if err := json.Unmarshal([]byte(raw), &store); err != nil {
+		return nil, fmt.Errorf("failed to parse %s annotation on node %s: %w", DiscoveredRoutesNodeAnnotation, node.Name, err)
+	}
+
+	return store, nil
+}
+
+// saveDiscoveredRoutes serializes store into node's
+// DiscoveredRoutesNodeAnnotation.
+func saveDiscoveredRoutes(node *v1.Node, store discoveredRouteStore) error {
+	raw, err := json.Marshal(store)
+	if err != nil {
+		return fmt.Errorf("failed to serialize discovered routes for node %s: %w", node.Name, err)
+	}
+
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+
+	node.Annotations[DiscoveredRoutesNodeAnnotation] = string(raw)
+
+	return nil
+}
+
+// routeGraceWindow returns how long a previously discovered ExternalIP
+// keeps being advertised after its link stops reporting it.
+func (cfg *cloudConfig) routeGraceWindow() time.Duration {
+	if cfg.Global.RouteGraceWindow == "" {
+		return defaultRouteGraceWindow
+	}
+
+	d, err := time.ParseDuration(cfg.Global.RouteGraceWindow)
+	if err != nil {
+		return defaultRouteGraceWindow
+	}
+
+	return d
+}
+
+// externalLinkAllowed reports whether link is eligible to be discovered as
+// an external address. An empty ExternalLinkNames allow-list permits
+// every link, deferring entirely to the per-platform heuristics in
+// getNodeAddresses.
+func (cfg *cloudConfig) externalLinkAllowed(link string) bool {
+	if len(cfg.Global.ExternalLinkNames) == 0 {
+		return true
+	}
+
+	for _, allowed := range cfg.Global.ExternalLinkNames {
+		if allowed == link {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeDiscoveredRoutes folds this poll's candidates into store: it
+// refreshes LastSeen for families whose link is still reporting an
+// address, keeps a previously-seen family alive through cfg's grace
+// window once its link stops reporting, and immediately forgets any
+// family the operator has reconfigured out of eligibility, whether via
+// the legacy ExternalLinkNames allow-list or by narrowing AddressFilters
+// so it no longer classifies the route's link as a NodeExternalIP.
+func mergeDiscoveredRoutes(cfg *cloudConfig, platform string, filters []AddressFilter, store discoveredRouteStore, candidates map[string]discoveredRoute, now time.Time) discoveredRouteStore {
+	merged := discoveredRouteStore{}
+
+	for family, candidate := range candidates {
+		merged[family] = candidate
+	}
+
+	grace := cfg.routeGraceWindow()
+
+	for family, route := range store {
+		if _, seenThisPoll := merged[family]; seenThisPoll {
+			continue
+		}
+
+		if !cfg.externalLinkAllowed(route.LinkName) {
+			// The operator removed this link from the allow-list: garbage
+			// collect it immediately, don't wait out the grace window.
+			continue
+		}
+
+		if !routeStillExternal(platform, filters, route) {
+			// The operator reconfigured AddressFilters so this link no
+			// longer classifies as a NodeExternalIP: same immediate GC as
+			// above, just driven by the newer mechanism.
+			continue
+		}
+
+		if now.Sub(route.LastSeen) > grace {
+			continue
+		}
+
+		merged[family] = route
+	}
+
+	return merged
+}
+
+// routeStillExternal reports whether route's address, re-evaluated
+// against the currently configured filters, still classifies as a
+// NodeExternalIP. An address that no longer parses is treated as no
+// longer eligible, so a corrupt stored route doesn't linger forever.
+func routeStillExternal(platform string, filters []AddressFilter, route discoveredRoute) bool {
+	addr, err := netip.ParseAddr(route.Address)
+	if err != nil {
+		return false
+	}
+
+	iface := network.AddressStatusSpec{
+		Address:  netip.PrefixFrom(addr, addr.BitLen()),
+		LinkName: route.LinkName,
+	}
+
+	addressType, ok := matchAddressFilters(filters, platform, iface)
+
+	return ok && addressType == v1.NodeExternalIP
+}
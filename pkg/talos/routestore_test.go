@@ -0,0 +1,43 @@
+package talos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiscoveredRoutesRoundTrip(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+
+	store := discoveredRouteStore{
+		"ipv4": {LinkName: "eth0", Address: "1.2.3.4", LastSeen: time.Unix(100, 0).UTC()},
+	}
+
+	require.NoError(t, saveDiscoveredRoutes(node, store))
+
+	loaded, err := loadDiscoveredRoutes(node)
+	require.NoError(t, err)
+	assert.Equal(t, store, loaded)
+}
+
+func TestLoadDiscoveredRoutesMissingAnnotation(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+
+	loaded, err := loadDiscoveredRoutes(node)
+	require.NoError(t, err)
+	assert.Empty(t, loaded)
+}
+
+func TestExternalLinkAllowed(t *testing.T) {
+	cfg := &cloudConfig{}
+	assert.True(t, cfg.externalLinkAllowed("eth0"))
+
+	cfg.Global.ExternalLinkNames = []string{"tailscale0"}
+	assert.False(t, cfg.externalLinkAllowed("eth0"))
+	assert.True(t, cfg.externalLinkAllowed("tailscale0"))
+}